@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const defaultDaemonInterval = 30 * time.Minute
+
+// runDaemon keeps the process alive and re-fetches each subscription on its
+// own ticker, derived from Subscription.Interval (falling back to
+// Config.Lite.Schedule, then defaultDaemonInterval). It never returns; the
+// bounded concurrency across subscriptions is enforced by store's worker
+// pool, not here.
+func runDaemon(cfg *Config, s *store) {
+	globalInterval := parseIntervalOrDefault(cfg.Lite.Schedule, defaultDaemonInterval)
+
+	done := make(chan struct{})
+	for _, key := range s.Keys() {
+		sub, ok := s.Sub(key)
+		if !ok {
+			continue
+		}
+		interval := parseIntervalOrDefault(sub.Interval, globalInterval)
+		go runSubscriptionTicker(s, key, interval)
+	}
+	<-done // block forever; the tickers run until the process exits
+}
+
+func runSubscriptionTicker(s *store, key string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.Refresh(key); err != nil {
+			log.Printf("daemon refresh %s: %v", key, err)
+		}
+	}
+}
+
+// parseIntervalOrDefault parses s as a time.Duration, falling back to def
+// when s is empty or invalid.
+func parseIntervalOrDefault(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Printf("invalid interval %q, using default %s: %v", s, def, err)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// canonicalKey returns a scheme-aware dedupe key for line: per scheme, it
+// lowercases the host, drops the fragment (#remark), and keeps every query
+// parameter (sorted, so reordering doesn't matter) rather than a hand-picked
+// subset - two vless/reality nodes that differ in flow/pbk/sid/fp/alpn, or
+// two vmess nodes that differ in aid/type, are genuinely different configs
+// and must not collapse to the same key. Lines whose scheme we don't
+// recognize fall back to the trimmed original string, matching the
+// historical byte-identical behavior.
+func canonicalKey(line string) string {
+	trimmed := strings.TrimSpace(line)
+	lower := strings.ToLower(trimmed)
+	switch {
+	case strings.HasPrefix(lower, "vless://"):
+		if key, ok := canonicalURIKey("vless", trimmed); ok {
+			return key
+		}
+	case strings.HasPrefix(lower, "ss://"):
+		if key, ok := canonicalSSKey(trimmed); ok {
+			return key
+		}
+	case strings.HasPrefix(lower, "vmess://"):
+		if key, ok := canonicalVmessKey(trimmed); ok {
+			return key
+		}
+	}
+	return trimmed
+}
+
+// canonicalURIKey canonicalizes a standard "scheme://user@host:port?query"
+// URI (vless): lowercase host, keep the full sorted query string, drop the
+// fragment.
+func canonicalURIKey(scheme, line string) (string, bool) {
+	u, err := url.Parse(line)
+	if err != nil {
+		return "", false
+	}
+	parts := []string{scheme, u.User.String(), strings.ToLower(u.Hostname()), u.Port(), sortedQuery(u.Query())}
+	return strings.Join(parts, "|"), true
+}
+
+// canonicalSSKey handles both SIP002 (base64(method:password)@host:port?...)
+// and legacy (base64(method:password@host:port)) ss:// forms.
+func canonicalSSKey(line string) (string, bool) {
+	rest := strings.TrimPrefix(line, "ss://")
+	if idx := strings.Index(rest, "#"); idx >= 0 {
+		rest = rest[:idx]
+	}
+
+	if at := strings.Index(rest, "@"); at >= 0 {
+		methodPass, err := decodeSSUserInfo(rest[:at])
+		if err != nil {
+			return "", false
+		}
+		hostpart := rest[at+1:]
+		query := ""
+		if q := strings.Index(hostpart, "?"); q >= 0 {
+			query = hostpart[q+1:]
+			hostpart = hostpart[:q]
+		}
+		host, port, err := splitHostPortLoose(hostpart)
+		if err != nil {
+			return "", false
+		}
+		qv, _ := url.ParseQuery(query)
+		return strings.Join([]string{"ss", methodPass, strings.ToLower(host), port, sortedQuery(qv)}, "|"), true
+	}
+
+	decoded, err := decodeSSUserInfo(rest)
+	if err != nil {
+		return "", false
+	}
+	at := strings.LastIndex(decoded, "@")
+	if at < 0 {
+		return "", false
+	}
+	methodPass, hostport := decoded[:at], decoded[at+1:]
+	host, port, err := splitHostPortLoose(hostport)
+	if err != nil {
+		return "", false
+	}
+	return strings.Join([]string{"ss", methodPass, strings.ToLower(host), port}, "|"), true
+}
+
+// canonicalVmessKey canonicalizes the base64-encoded JSON payload: drop only
+// "ps" (the remark), keep every other field so nodes that differ in aid,
+// type (header obfuscation), tls, sni, etc. stay distinct. encoding/json
+// marshals map keys in sorted order, so this is reorder-proof by
+// construction.
+func canonicalVmessKey(line string) (string, bool) {
+	b64 := strings.TrimPrefix(line, "vmess://")
+	dec, err := base64.StdEncoding.DecodeString(padBase64(b64))
+	if err != nil {
+		return "", false
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(dec, &m); err != nil {
+		return "", false
+	}
+	delete(m, "ps")
+	canon, err := json.Marshal(m)
+	if err != nil {
+		return "", false
+	}
+	return "vmess|" + string(canon), true
+}
+
+// sortedQuery renders q deterministically regardless of parameter order.
+func sortedQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(q))
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// capMaxTotal truncates normal to maxTotal entries, preserving order.
+// maxTotal <= 0 disables the cap.
+func capMaxTotal(normal []string, maxTotal int) []string {
+	if maxTotal <= 0 || len(normal) <= maxTotal {
+		return normal
+	}
+	return append([]string(nil), normal[:maxTotal]...)
+}
+
+// capPerHost keeps at most perHostLimit entries from any single host:port
+// (as determined by hostKey), preserving order. perHostLimit <= 0 disables
+// the cap.
+func capPerHost(lines []string, perHostLimit int) []string {
+	if perHostLimit <= 0 {
+		return lines
+	}
+	counts := map[string]int{}
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		key := hostKey(line)
+		if counts[key] >= perHostLimit {
+			continue
+		}
+		counts[key]++
+		out = append(out, line)
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestCanonicalKeyVlessDistinguishesRealityParams(t *testing.T) {
+	base := "vless://uuid-1@example.com:443?type=tcp&security=reality&sni=example.com&pbk=AAAA&sid=01&fp=chrome#node-a"
+	sameButReordered := "vless://uuid-1@example.com:443?sni=example.com&security=reality&type=tcp&fp=chrome&pbk=AAAA&sid=01#node-b"
+	differentPbk := "vless://uuid-1@example.com:443?type=tcp&security=reality&sni=example.com&pbk=BBBB&sid=01&fp=chrome#node-c"
+
+	k1 := canonicalKey(base)
+	k2 := canonicalKey(sameButReordered)
+	k3 := canonicalKey(differentPbk)
+
+	if k1 != k2 {
+		t.Errorf("reordered query params should canonicalize identically: %q != %q", k1, k2)
+	}
+	if k1 == k3 {
+		t.Errorf("distinct pbk should not collapse to the same key: %q", k1)
+	}
+}
+
+func TestCanonicalKeyVmessDistinguishesAidAndType(t *testing.T) {
+	a := vmessLink(t, `{"v":"2","ps":"remark-a","add":"example.com","port":443,"id":"uuid-1","aid":0,"net":"ws","type":"none","tls":"tls"}`)
+	b := vmessLink(t, `{"v":"2","ps":"remark-b","add":"example.com","port":443,"id":"uuid-1","aid":0,"net":"ws","type":"none","tls":"tls"}`)
+	c := vmessLink(t, `{"v":"2","ps":"remark-c","add":"example.com","port":443,"id":"uuid-1","aid":1,"net":"ws","type":"none","tls":"tls"}`)
+	d := vmessLink(t, `{"v":"2","ps":"remark-d","add":"example.com","port":443,"id":"uuid-1","aid":0,"net":"ws","type":"http","tls":"tls"}`)
+
+	ka, kb, kc, kd := canonicalKey(a), canonicalKey(b), canonicalKey(c), canonicalKey(d)
+
+	if ka != kb {
+		t.Errorf("identical nodes differing only in remark should canonicalize identically: %q != %q", ka, kb)
+	}
+	if ka == kc {
+		t.Errorf("distinct aid should not collapse to the same key: %q", ka)
+	}
+	if ka == kd {
+		t.Errorf("distinct type should not collapse to the same key: %q", ka)
+	}
+}
+
+func TestCanonicalKeySSIgnoresRemark(t *testing.T) {
+	a := "ss://YWVzLTI1Ni1nY206cGFzc3dvcmQ@example.com:8388#remark-a"
+	b := "ss://YWVzLTI1Ni1nY206cGFzc3dvcmQ@example.com:8388#remark-b"
+	c := "ss://YWVzLTI1Ni1nY206b3RoZXI@example.com:8388#remark-a"
+
+	if canonicalKey(a) != canonicalKey(b) {
+		t.Errorf("remark alone should not change the dedupe key")
+	}
+	if canonicalKey(a) == canonicalKey(c) {
+		t.Errorf("different password should not collapse to the same key")
+	}
+}
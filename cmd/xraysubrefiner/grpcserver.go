@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+// The types below mirror proto/refiner.proto. They're normally produced by
+// protoc-gen-go / protoc-gen-go-grpc; they're hand-written here so the
+// service builds without a protoc toolchain in this tree, and are carried
+// over the wire with refinerCodec (JSON) rather than real protobuf encoding
+// since they don't implement proto.Message. Regenerate with:
+//
+//	protoc --go_out=. --go-grpc_out=. proto/refiner.proto
+
+type GetSubscriptionRequest struct {
+	Key     string `json:"key"`
+	Variant string `json:"variant"`
+}
+
+type GetSubscriptionResponse struct {
+	Payload []byte `json:"payload"`
+}
+
+type RefreshRequest struct {
+	Key string `json:"key"`
+}
+
+type RefreshResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// refinerCodecName is the name refinerCodec registers under; DialRefiner's
+// forced codec sends it as the content-subtype, while runGRPCServer forces
+// refinerCodec whatever content-subtype arrives.
+const refinerCodecName = "xraysubrefiner-json"
+
+// refinerCodec carries GetSubscriptionRequest/Response and friends over the
+// wire as JSON. It exists because those types are plain Go structs, not
+// generated protobuf messages (no Reset/ProtoReflect), so grpc-go's default
+// codec cannot marshal them.
+type refinerCodec struct{}
+
+func (refinerCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (refinerCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (refinerCodec) Name() string                               { return refinerCodecName }
+
+func init() {
+	encoding.RegisterCodec(refinerCodec{})
+}
+
+// RefinerServer is the gRPC-facing interface backed by store.
+type RefinerServer interface {
+	GetSubscription(context.Context, *GetSubscriptionRequest) (*GetSubscriptionResponse, error)
+	Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error)
+}
+
+// refinerServer adapts store to RefinerServer.
+type refinerServer struct {
+	store *store
+}
+
+func (r *refinerServer) GetSubscription(_ context.Context, req *GetSubscriptionRequest) (*GetSubscriptionResponse, error) {
+	if req.Variant != "normal" && req.Variant != "lite" {
+		return nil, fmt.Errorf("unknown variant %q", req.Variant)
+	}
+	payload, ok := r.store.Get(req.Key, req.Variant)
+	if !ok {
+		return nil, fmt.Errorf("no %s payload for %q yet", req.Variant, req.Key)
+	}
+	return &GetSubscriptionResponse{Payload: payload}, nil
+}
+
+func (r *refinerServer) Refresh(_ context.Context, req *RefreshRequest) (*RefreshResponse, error) {
+	keys := []string{req.Key}
+	if req.Key == "" {
+		keys = r.store.Keys()
+	}
+	var errs []string
+	for _, key := range keys {
+		if err := r.store.Refresh(key); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	return &RefreshResponse{Errors: errs}, nil
+}
+
+var refinerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "refiner.Refiner",
+	HandlerType: (*RefinerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSubscription",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(GetSubscriptionRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(RefinerServer).GetSubscription(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/refiner.Refiner/GetSubscription"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RefinerServer).GetSubscription(ctx, req.(*GetSubscriptionRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+		{
+			MethodName: "Refresh",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(RefreshRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(RefinerServer).Refresh(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/refiner.Refiner/Refresh"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RefinerServer).Refresh(ctx, req.(*RefreshRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/refiner.proto",
+}
+
+// runGRPCServer starts the Refiner gRPC service backed by s and blocks until
+// the listener fails. It forces refinerCodec server-wide so it doesn't
+// matter what content-subtype (if any) a client requests; DialRefiner
+// configures the matching client-side codec.
+func runGRPCServer(addr string, s *store) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(grpc.ForceServerCodec(refinerCodec{}))
+	srv.RegisterService(&refinerServiceDesc, &refinerServer{store: s})
+	return srv.Serve(lis)
+}
+
+// RefinerClient is a hand-written client stub for the Refiner service,
+// mirroring what protoc-gen-go-grpc would generate from proto/refiner.proto.
+type RefinerClient struct {
+	cc *grpc.ClientConn
+}
+
+// DialRefiner connects to a Refiner server started by runGRPCServer. The
+// connection is unauthenticated (plaintext) and forces refinerCodec so
+// requests/responses round-trip as JSON instead of failing against the
+// default proto codec.
+func DialRefiner(addr string, extraOpts ...grpc.DialOption) (*RefinerClient, error) {
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(refinerCodec{})),
+	}, extraOpts...)
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &RefinerClient{cc: conn}, nil
+}
+
+func (c *RefinerClient) Close() error {
+	return c.cc.Close()
+}
+
+func (c *RefinerClient) GetSubscription(ctx context.Context, req *GetSubscriptionRequest) (*GetSubscriptionResponse, error) {
+	resp := new(GetSubscriptionResponse)
+	if err := c.cc.Invoke(ctx, "/refiner.Refiner/GetSubscription", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *RefinerClient) Refresh(ctx context.Context, req *RefreshRequest) (*RefreshResponse, error) {
+	resp := new(RefreshResponse)
+	if err := c.cc.Invoke(ctx, "/refiner.Refiner/Refresh", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// runHTTPServer serves the refined subscriptions held by s until the process
+// is stopped or the listener fails.
+//
+// Routes:
+//
+//	GET  /sub/{key}/{normal|lite}  -> Base64 payload for that subscription
+//	POST /refresh                 -> re-refine every configured subscription
+//	POST /refresh/{key}           -> re-refine a single subscription
+func runHTTPServer(addr string, s *store) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sub/", func(w http.ResponseWriter, r *http.Request) {
+		handleGetSubscription(w, r, s)
+	})
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		handleRefresh(w, r, s)
+	})
+	mux.HandleFunc("/refresh/", func(w http.ResponseWriter, r *http.Request) {
+		handleRefresh(w, r, s)
+	})
+	return http.ListenAndServe(addr, mux)
+}
+
+func handleGetSubscription(w http.ResponseWriter, r *http.Request, s *store) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Path shape: /sub/{key}/{variant}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/sub/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected /sub/{key}/{normal|lite}", http.StatusBadRequest)
+		return
+	}
+	key, variant := parts[0], parts[1]
+	if variant != "normal" && variant != "lite" {
+		http.Error(w, fmt.Sprintf("unknown variant %q", variant), http.StatusBadRequest)
+		return
+	}
+
+	payload, ok := s.Get(key, variant)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no %s payload for %q yet", variant, key), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(payload)
+}
+
+func handleRefresh(w http.ResponseWriter, r *http.Request, s *store) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/refresh"), "/")
+	if key == "" {
+		var errs []string
+		for _, k := range s.Keys() {
+			if err := s.Refresh(k); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", k, err))
+			}
+		}
+		if len(errs) > 0 {
+			http.Error(w, strings.Join(errs, "; "), http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+		return
+	}
+
+	if err := s.Refresh(key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
@@ -15,6 +17,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -23,20 +26,32 @@ import (
 type Subscription struct {
 	Key string `yaml:"key"`
 	URL string `yaml:"url"`
+	// Interval overrides lite.schedule for this subscription in -daemon mode
+	// (e.g. "30m"). Empty means "use the global schedule".
+	Interval string `yaml:"interval"`
 }
 
 type LiteCfg struct {
-	// Kept for compatibility with config structure; Lite always takes last N now.
+	// Strategy selects how lite is built: "" (default) takes the last N
+	// entries preserving source order; "fastest" sorts by measured RTT and
+	// requires probe.enabled (see buildLite).
 	Strategy     string `yaml:"strategy"`
 	MaxTotal     int    `yaml:"max_total"`
 	PerHostLimit int    `yaml:"per_host_limit"`
 	N            int    `yaml:"n"`
+	// Schedule is the default -daemon re-fetch interval (e.g. "30m") for
+	// subscriptions that don't set their own Interval.
+	Schedule string `yaml:"schedule"`
 }
 
 type Config struct {
-	AllowedSchemes []string       `yaml:"allowed_schemes"`
-	Lite           LiteCfg        `yaml:"lite"`
-	Subscriptions  []Subscription `yaml:"subscriptions"`
+	AllowedSchemes []string `yaml:"allowed_schemes"`
+	Lite           LiteCfg  `yaml:"lite"`
+	Probe          ProbeCfg `yaml:"probe"`
+	// Outputs selects which formats are written per subscription/variant:
+	// any of "base64" (default), "clash", "singbox", "plain".
+	Outputs       []string       `yaml:"outputs"`
+	Subscriptions []Subscription `yaml:"subscriptions"`
 }
 
 var (
@@ -55,14 +70,59 @@ func main() {
 	cfgPath := flag.String("config", "config.yaml", "path to config.yaml")
 	outDir := flag.String("out", "export", "output directory")
 	timeout := flag.Duration("timeout", 20*time.Second, "HTTP client timeout")
+	serveAddr := flag.String("serve", "", "if set, start an HTTP server on this address (e.g. :8080) after the initial pass instead of exiting")
+	grpcAddr := flag.String("grpc", "", "if set, start a gRPC server on this address alongside -serve")
+	daemon := flag.Bool("daemon", false, "keep running and re-fetch each subscription on its own ticker instead of exiting after one pass")
+	workers := flag.Int("workers", 4, "max number of subscriptions refreshed concurrently")
 	flag.Parse()
 
 	cfg, err := loadConfig(*cfgPath)
 	must(err)
 
 	client := &http.Client{Timeout: *timeout}
+	allowed := allowedSchemes(cfg)
 
-	// Allowed schemes set
+	store := newStore(cfg, client, allowed, *outDir, *workers)
+	store.refineAll()
+
+	if *serveAddr == "" && *grpcAddr == "" && !*daemon {
+		return
+	}
+
+	var wg sync.WaitGroup
+	if *daemon {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runDaemon(cfg, store)
+		}()
+	}
+	if *serveAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Printf("HTTP server listening on %s", *serveAddr)
+			if err := runHTTPServer(*serveAddr, store); err != nil {
+				log.Fatalf("http server: %v", err)
+			}
+		}()
+	}
+	if *grpcAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Printf("gRPC server listening on %s", *grpcAddr)
+			if err := runGRPCServer(*grpcAddr, store); err != nil {
+				log.Fatalf("grpc server: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// allowedSchemes builds the allowed-scheme set from config, falling back to
+// the historical default of vless/vmess/ss when none is configured.
+func allowedSchemes(cfg *Config) map[string]struct{} {
 	allowed := map[string]struct{}{}
 	for _, s := range cfg.AllowedSchemes {
 		allowed[strings.ToLower(strings.TrimSpace(s))] = struct{}{}
@@ -72,34 +132,139 @@ func main() {
 			allowed[s] = struct{}{}
 		}
 	}
+	return allowed
+}
 
-	for _, sub := range cfg.Subscriptions {
-		fmt.Printf("Processing %s (%s)\n", sub.Key, sub.URL)
-		raw, err := fetch(client, sub.URL)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "!! fetch error %s: %v\n", sub.URL, err)
-			continue
+// refineOutcome is the result of one refineSubscription call. NotModified is
+// set when the conditional fetch returned 304 or the normalized payload hash
+// didn't change. Normal/Lite are nil only after a 304; on an unchanged hash
+// they are still filled in, and callers keep whatever they already have
+// cached unless their cache is empty.
+type refineOutcome struct {
+	Normal       []string
+	Lite         []string
+	NotModified  bool
+	PayloadHash  string
+	ETag         string
+	LastModified string
+}
+
+// refineSubscription runs the fetch -> decode -> parse -> dedupe pipeline for
+// a single subscription. prev carries the ETag/Last-Modified/payload hash
+// observed on the previous run so unchanged sources can short-circuit. The
+// normal set is never filtered by probe results; probing only gates which
+// nodes are eligible for "lite" (see buildLite).
+func refineSubscription(client *http.Client, sub Subscription, allowed map[string]struct{}, liteCfg LiteCfg, probeCfg ProbeCfg, lru *probeLRU, prev fetchState) (refineOutcome, error) {
+	raw, notModified, etag, lastModified, err := fetchConditional(client, sub.URL, prev.ETag, prev.LastModified)
+	if err != nil {
+		return refineOutcome{}, err
+	}
+	if notModified {
+		return refineOutcome{NotModified: true, PayloadHash: prev.PayloadHash, ETag: etag, LastModified: lastModified}, nil
+	}
+
+	decoded := tryDecodeIfBase64(raw)
+	valid := parseAndFilterLines(decoded, allowed)
+	normal := capMaxTotal(dedupe(valid), liteCfg.MaxTotal)
+
+	aliveLines := capPerHost(normal, liteCfg.PerHostLimit)
+	var latencyByLine map[string]time.Duration
+	if probeCfg.Enabled {
+		probed := probeAndFilter(aliveLines, probeCfg, lru)
+		aliveLines = make([]string, 0, len(probed))
+		latencyByLine = make(map[string]time.Duration, len(probed))
+		for _, p := range probed {
+			aliveLines = append(aliveLines, p.Line)
+			latencyByLine[p.Line] = p.Latency
 		}
+	} else if liteCfg.Strategy == "fastest" {
+		log.Printf("lite.strategy=fastest requires probe.enabled for %s; falling back to last-N", sub.Key)
+	}
+	lite := buildLite(liteCfg, aliveLines, latencyByLine)
 
-		decoded := tryDecodeIfBase64(raw)
-		valid := parseAndFilterLines(decoded, allowed)
+	hash := hashPayload(normal)
+	// Normal/Lite are still returned on an unchanged hash so callers can
+	// populate an empty cache (e.g. right after a daemon restart); only the
+	// on-disk write is meant to be skipped in that case.
+	return refineOutcome{Normal: normal, Lite: lite, NotModified: hash == prev.PayloadHash, PayloadHash: hash, ETag: etag, LastModified: lastModified}, nil
+}
 
-		normal := dedupe(valid)
-		lite := buildLiteTail(normal, 100) // take last 100 preserving order
+// writeSubscriptionFiles writes the normal/lite outputs for sub under
+// outDir/<sanitized key>/, in every format listed in outputs. "base64"
+// preserves the historical "normal"/"lite" filenames with no extension;
+// every other format is written alongside as "<variant><suffix>".
+func writeSubscriptionFiles(outDir string, sub Subscription, normal, lite []string, outputs []string) error {
+	keyDir := filepath.Join(outDir, sanitizeFileName(sub.Key))
+	if err := os.MkdirAll(keyDir, 0o755); err != nil {
+		return err
+	}
 
-		keyDir := filepath.Join(*outDir, sanitizeFileName(sub.Key))
-		if err := os.MkdirAll(keyDir, 0o755); err != nil {
-			must(err)
+	variants := []struct {
+		name  string
+		lines []string
+	}{
+		{"normal", normal},
+		{"lite", lite},
+	}
+
+	for _, format := range outputs {
+		if format == "base64" {
+			if err := writeBase64Sorted(filepath.Join(keyDir, "normal"), normal); err != nil {
+				return err
+			}
+			if err := writeBase64NoSort(filepath.Join(keyDir, "lite"), lite); err != nil {
+				return err
+			}
+			continue
+		}
+		spec, ok := outputFormats[format]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "!! unknown output format %q\n", format)
+			continue
+		}
+		for _, v := range variants {
+			data, err := spec.encode(v.lines)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "!! encode %s for %s/%s: %v\n", format, sub.Key, v.name, err)
+				continue
+			}
+			if err := writeFileAtomic(filepath.Join(keyDir, v.name+spec.suffix), data); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
 
-		// Write Base64-encoded outputs (no file extension)
-		if err := writeBase64Sorted(filepath.Join(keyDir, "normal"), normal); err != nil {
-			must(err)
+// expectedOutputFiles lists every file writeSubscriptionFiles is expected to
+// produce for sub under outDir, given the configured outputs. Used to detect
+// outputs missing from disk (e.g. outputs config changed, or export/ was
+// cleared) even though the upstream payload hash is unchanged.
+func expectedOutputFiles(outDir string, sub Subscription, outputs []string) []string {
+	keyDir := filepath.Join(outDir, sanitizeFileName(sub.Key))
+	var files []string
+	for _, format := range outputs {
+		if format == "base64" {
+			files = append(files, filepath.Join(keyDir, "normal"), filepath.Join(keyDir, "lite"))
+			continue
 		}
-		if err := writeBase64NoSort(filepath.Join(keyDir, "lite"), lite); err != nil {
-			must(err)
+		spec, ok := outputFormats[format]
+		if !ok {
+			continue
 		}
+		files = append(files, filepath.Join(keyDir, "normal"+spec.suffix), filepath.Join(keyDir, "lite"+spec.suffix))
 	}
+	return files
+}
+
+// allFilesExist reports whether every path in files exists.
+func allFilesExist(files []string) bool {
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -111,35 +276,73 @@ func loadConfig(path string) (*Config, error) {
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
 		return nil, err
 	}
-	// Reasonable defaults
-	if cfg.Lite.MaxTotal <= 0 {
-		cfg.Lite.MaxTotal = 100
-	}
+	// Reasonable defaults. MaxTotal is intentionally left at 0 (disabled)
+	// when unset - it now caps the normal set, so defaulting it would
+	// silently truncate existing deployments that never configured it.
 	if cfg.Lite.N <= 0 {
 		cfg.Lite.N = 100
 	}
+	if cfg.Probe.Enabled {
+		if cfg.Probe.Concurrency <= 0 {
+			cfg.Probe.Concurrency = defaultProbeConcurrency
+		}
+		if cfg.Probe.Timeout == "" {
+			cfg.Probe.Timeout = defaultProbeTimeout.String()
+		}
+	}
+	if len(cfg.Outputs) == 0 {
+		cfg.Outputs = []string{"base64"}
+	}
 	return &cfg, nil
 }
 
 func fetch(client *http.Client, rawurl string) ([]byte, error) {
+	body, _, _, _, err := fetchConditional(client, rawurl, "", "")
+	return body, err
+}
+
+// fetchConditional fetches rawurl, sending If-None-Match/If-Modified-Since
+// when etag/lastModified are non-empty. notModified reports a 304 response;
+// in that case body is nil and the caller should keep what it already has.
+func fetchConditional(client *http.Client, rawurl, etag, lastModified string) (body []byte, notModified bool, newETag, newLastModified string, err error) {
 	req, err := http.NewRequest("GET", rawurl, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, "", "", err
 	}
 	req.Header.Set("User-Agent", "XraySubRefiner/1.1")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, false, "", "", err
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, true, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+	}
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("status %d", resp.StatusCode)
+		return nil, false, "", "", fmt.Errorf("status %d", resp.StatusCode)
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, false, "", "", err
 	}
-	return body, nil
+	return body, false, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+}
+
+// hashPayload returns a stable hash of normal over the same sorted
+// representation writeBase64Sorted writes to disk, so an unchanged hash
+// really means an unchanged "normal" output.
+func hashPayload(normal []string) string {
+	cp := append([]string(nil), normal...)
+	sort.Strings(cp)
+	sum := sha256.Sum256([]byte(strings.Join(cp, "\n")))
+	return hex.EncodeToString(sum[:])
 }
 
 func tryDecodeIfBase64(b []byte) []byte {
@@ -241,6 +444,10 @@ func isSchemeChar(c byte) bool {
 	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
 
+// dedupe collapses semantically-equivalent nodes, not just byte-identical
+// lines: the same node re-published with a different #remark or reordered
+// query params canonicalizes to the same key (see canonicalKey). The first
+// occurrence's original string is kept for output.
 func dedupe(in []string) []string {
 	seen := map[string]struct{}{}
 	out := make([]string, 0, len(in))
@@ -249,10 +456,11 @@ func dedupe(in []string) []string {
 		if k == "" {
 			continue
 		}
-		if _, ok := seen[k]; ok {
+		ck := canonicalKey(k)
+		if _, ok := seen[ck]; ok {
 			continue
 		}
-		seen[k] = struct{}{}
+		seen[ck] = struct{}{}
 		out = append(out, k)
 	}
 	return out
@@ -300,12 +508,32 @@ func writeBase64NoSort(path string, lines []string) error {
 	return writeBase64Atomic(path, lines)
 }
 
-// writeBase64Atomic joins lines with '\n', encodes the entire content in Base64,
-// then writes atomically with retries (Windows-friendly).
-func writeBase64Atomic(path string, lines []string) error {
+// encodeBase64Sorted returns the Base64 payload writeBase64Sorted would
+// write, without touching the filesystem.
+func encodeBase64Sorted(lines []string) []byte {
+	cp := append([]string(nil), lines...)
+	sort.Strings(cp)
+	return encodeBase64(cp)
+}
+
+// encodeBase64 joins lines with '\n' and Base64-encodes the result, matching
+// the payload writeBase64Atomic writes to disk.
+func encodeBase64(lines []string) []byte {
 	payload := strings.Join(lines, "\n")
-	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
+	return []byte(base64.StdEncoding.EncodeToString([]byte(payload)))
+}
+
+// writeBase64Atomic joins lines with '\n', encodes the entire content in
+// Base64, then writes atomically with retries (Windows-friendly).
+func writeBase64Atomic(path string, lines []string) error {
+	return writeFileAtomic(path, encodeBase64(lines))
+}
 
+// writeFileAtomic writes data to path via a tmp-file-then-rename, retrying
+// the rename on Windows sharing-violation-style errors. Every writer
+// (Base64, Clash, sing-box, plain) goes through this so file consumers never
+// observe a partially written output, regardless of format.
+func writeFileAtomic(path string, data []byte) error {
 	dir := filepath.Dir(path)
 	base := filepath.Base(path)
 	tmpFile, err := os.CreateTemp(dir, base+".*.tmp")
@@ -315,7 +543,7 @@ func writeBase64Atomic(path string, lines []string) error {
 	tmpPath := tmpFile.Name()
 
 	w := bufio.NewWriter(tmpFile)
-	if _, err := w.WriteString(encoded); err != nil {
+	if _, err := w.Write(data); err != nil {
 		tmpFile.Close()
 		_ = os.Remove(tmpPath)
 		return err
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Node is the common intermediate representation every scheme-specific
+// parser produces, and every format-specific writer consumes. Raw is kept
+// around so passthrough formats (base64, plain) never need to round-trip
+// through Node at all.
+type Node struct {
+	Scheme   string // vless, vmess, ss
+	Remark   string
+	Server   string
+	Port     int
+	UUID     string // vless/vmess id
+	Password string // ss password
+	Method   string // ss cipher
+	Network  string // ws, tcp, grpc, ...
+	TLS      bool
+	SNI      string
+	Path     string
+	Host     string // ws/h2 Host header
+	Raw      string
+}
+
+// parseNodes parses every line into a Node, skipping (and logging) any line
+// whose scheme-specific parser fails rather than aborting the whole batch.
+func parseNodes(lines []string) []Node {
+	out := make([]Node, 0, len(lines))
+	for _, line := range lines {
+		n, err := parseNode(line)
+		if err != nil {
+			fmt.Printf("!! skip node for formatted output: %v\n", err)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func parseNode(line string) (Node, error) {
+	switch {
+	case strings.HasPrefix(line, "vless://"):
+		return parseVless(line)
+	case strings.HasPrefix(line, "vmess://"):
+		return parseVmess(line)
+	case strings.HasPrefix(line, "ss://"):
+		return parseSS(line)
+	default:
+		return Node{}, fmt.Errorf("unsupported scheme for %q", line)
+	}
+}
+
+// parseVless parses vless://uuid@host:port?params#remark.
+func parseVless(line string) (Node, error) {
+	u, err := url.Parse(line)
+	if err != nil {
+		return Node{}, fmt.Errorf("parse vless: %w", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	q := u.Query()
+	n := Node{
+		Scheme:  "vless",
+		Remark:  decodeFragment(u.Fragment),
+		Server:  u.Hostname(),
+		Port:    port,
+		UUID:    u.User.Username(),
+		Network: firstNonEmpty(q.Get("type"), "tcp"),
+		TLS:     q.Get("security") == "tls" || q.Get("security") == "reality",
+		SNI:     q.Get("sni"),
+		Path:    q.Get("path"),
+		Host:    q.Get("host"),
+		Raw:     line,
+	}
+	return n, nil
+}
+
+// parseSS parses both legacy ss://base64(method:password@host:port)#remark
+// and SIP002 ss://base64(method:password)@host:port?...#remark.
+func parseSS(line string) (Node, error) {
+	rest := strings.TrimPrefix(line, "ss://")
+	remark := ""
+	if idx := strings.Index(rest, "#"); idx >= 0 {
+		remark = decodeFragment(rest[idx+1:])
+		rest = rest[:idx]
+	}
+
+	if at := strings.Index(rest, "@"); at >= 0 {
+		// SIP002: base64(method:password)@host:port[?params]
+		userInfo, hostpart := rest[:at], rest[at+1:]
+		methodPass, err := decodeSSUserInfo(userInfo)
+		if err != nil {
+			return Node{}, fmt.Errorf("parse ss userinfo: %w", err)
+		}
+		hostport := hostpart
+		if q := strings.IndexAny(hostpart, "?/"); q >= 0 {
+			hostport = hostpart[:q]
+		}
+		host, portStr, err := splitHostPortLoose(hostport)
+		if err != nil {
+			return Node{}, fmt.Errorf("parse ss host:port: %w", err)
+		}
+		method, password, err := splitMethodPassword(methodPass)
+		if err != nil {
+			return Node{}, err
+		}
+		port, _ := strconv.Atoi(portStr)
+		return Node{Scheme: "ss", Remark: remark, Server: host, Port: port, Method: method, Password: password, Network: "tcp", Raw: line}, nil
+	}
+
+	// Legacy: base64(method:password@host:port)
+	decoded, err := decodeSSUserInfo(rest)
+	if err != nil {
+		return Node{}, fmt.Errorf("decode legacy ss: %w", err)
+	}
+	at := strings.LastIndex(decoded, "@")
+	if at < 0 {
+		return Node{}, fmt.Errorf("legacy ss missing '@': %q", decoded)
+	}
+	methodPass, hostport := decoded[:at], decoded[at+1:]
+	method, password, err := splitMethodPassword(methodPass)
+	if err != nil {
+		return Node{}, err
+	}
+	host, portStr, err := splitHostPortLoose(hostport)
+	if err != nil {
+		return Node{}, fmt.Errorf("parse ss host:port: %w", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return Node{Scheme: "ss", Remark: remark, Server: host, Port: port, Method: method, Password: password, Network: "tcp", Raw: line}, nil
+}
+
+func splitMethodPassword(s string) (method, password string, err error) {
+	idx := strings.Index(s, ":")
+	if idx < 0 {
+		return "", "", fmt.Errorf("missing ':' in method:password %q", s)
+	}
+	return s[:idx], s[idx+1:], nil
+}
+
+func splitHostPortLoose(s string) (host, port string, err error) {
+	idx := strings.LastIndex(s, ":")
+	if idx < 0 {
+		return "", "", fmt.Errorf("missing ':' in host:port %q", s)
+	}
+	return s[:idx], s[idx+1:], nil
+}
+
+func decodeSSUserInfo(s string) (string, error) {
+	dec, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		dec, err = base64.StdEncoding.DecodeString(padBase64(s))
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(dec), nil
+}
+
+// flexString decodes a JSON string or a JSON number into a string, since
+// different vmess link generators emit "port"/"aid" as either.
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexString(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("not a string or number: %s", data)
+	}
+	*f = flexString(n.String())
+	return nil
+}
+
+// vmessPayload mirrors the JSON object v2rayN/v2rayNG embed base64-encoded
+// after "vmess://".
+type vmessPayload struct {
+	V    string     `json:"v"`
+	PS   string     `json:"ps"`
+	Add  string     `json:"add"`
+	Port flexString `json:"port"` // generators vary between a string and a number
+	ID   string     `json:"id"`
+	Aid  flexString `json:"aid"`
+	Net  string     `json:"net"`
+	Type string     `json:"type"`
+	Host string     `json:"host"`
+	Path string     `json:"path"`
+	TLS  string     `json:"tls"`
+	SNI  string     `json:"sni"`
+}
+
+func parseVmess(line string) (Node, error) {
+	b64 := strings.TrimPrefix(line, "vmess://")
+	dec, err := base64.StdEncoding.DecodeString(padBase64(b64))
+	if err != nil {
+		return Node{}, fmt.Errorf("decode vmess: %w", err)
+	}
+	var p vmessPayload
+	if err := json.Unmarshal(dec, &p); err != nil {
+		return Node{}, fmt.Errorf("unmarshal vmess json: %w", err)
+	}
+	port, _ := strconv.Atoi(string(p.Port))
+	return Node{
+		Scheme:  "vmess",
+		Remark:  p.PS,
+		Server:  p.Add,
+		Port:    port,
+		UUID:    p.ID,
+		Network: firstNonEmpty(p.Net, "tcp"),
+		TLS:     p.TLS == "tls",
+		SNI:     firstNonEmpty(p.SNI, p.Host),
+		Path:    p.Path,
+		Host:    p.Host,
+		Raw:     line,
+	}, nil
+}
+
+func decodeFragment(s string) string {
+	if u, err := url.QueryUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func padBase64(s string) string {
+	if m := len(s) % 4; m != 0 {
+		s += strings.Repeat("=", 4-m)
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func vmessLink(t *testing.T, jsonPayload string) string {
+	t.Helper()
+	return "vmess://" + base64.StdEncoding.EncodeToString([]byte(jsonPayload))
+}
+
+func TestParseVmessPortAndAidTypes(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+		want    int
+	}{
+		{
+			name:    "string port and aid",
+			payload: `{"v":"2","ps":"node-a","add":"example.com","port":"443","id":"uuid-1","aid":"0","net":"ws","type":"none","host":"example.com","path":"/ws","tls":"tls"}`,
+			want:    443,
+		},
+		{
+			name:    "numeric port and aid",
+			payload: `{"v":"2","ps":"node-b","add":"example.com","port":443,"id":"uuid-1","aid":0,"net":"ws","type":"none","host":"example.com","path":"/ws","tls":"tls"}`,
+			want:    443,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := parseVmess(vmessLink(t, tc.payload))
+			if err != nil {
+				t.Fatalf("parseVmess: %v", err)
+			}
+			if n.Port != tc.want {
+				t.Errorf("Port = %d, want %d", n.Port, tc.want)
+			}
+			if n.Server != "example.com" {
+				t.Errorf("Server = %q, want example.com", n.Server)
+			}
+		})
+	}
+}
+
+func TestParseVless(t *testing.T) {
+	line := "vless://uuid-1@example.com:443?type=ws&security=tls&sni=example.com&path=%2Fws#my-node"
+	n, err := parseVless(line)
+	if err != nil {
+		t.Fatalf("parseVless: %v", err)
+	}
+	if n.Server != "example.com" || n.Port != 443 || n.UUID != "uuid-1" {
+		t.Fatalf("unexpected node: %+v", n)
+	}
+	if !n.TLS {
+		t.Errorf("TLS = false, want true")
+	}
+	if n.Remark != "my-node" {
+		t.Errorf("Remark = %q, want my-node", n.Remark)
+	}
+}
+
+func TestParseSS(t *testing.T) {
+	t.Run("sip002", func(t *testing.T) {
+		userinfo := base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:password"))
+		line := "ss://" + userinfo + "@example.com:8388?plugin=obfs#remark"
+		n, err := parseSS(line)
+		if err != nil {
+			t.Fatalf("parseSS: %v", err)
+		}
+		if n.Server != "example.com" || n.Port != 8388 || n.Method != "aes-256-gcm" || n.Password != "password" {
+			t.Fatalf("unexpected node: %+v", n)
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		whole := base64.StdEncoding.EncodeToString([]byte("aes-256-gcm:password@example.com:8388"))
+		line := "ss://" + whole + "#remark"
+		n, err := parseSS(line)
+		if err != nil {
+			t.Fatalf("parseSS: %v", err)
+		}
+		if n.Server != "example.com" || n.Port != 8388 || n.Method != "aes-256-gcm" || n.Password != "password" {
+			t.Fatalf("unexpected node: %+v", n)
+		}
+	})
+}
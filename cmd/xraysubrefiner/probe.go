@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProbeCfg configures the optional liveness probe that gates which deduped
+// nodes are eligible for "lite" (the normal set is never filtered by probe
+// results; see buildLite).
+type ProbeCfg struct {
+	Enabled     bool   `yaml:"enabled"`
+	Concurrency int    `yaml:"concurrency"`
+	Timeout     string `yaml:"timeout"`
+	TLSSNICheck bool   `yaml:"tls_sni_check"`
+	MaxLatency  string `yaml:"max_latency"`
+}
+
+const (
+	defaultProbeConcurrency = 20
+	defaultProbeTimeout     = 3 * time.Second
+	probeLRUCapacity        = 4096
+	probeLRUTTL             = 10 * time.Minute
+)
+
+// nodeProbe is one line from the deduped "normal" set paired with its
+// measured TCP/TLS round-trip.
+type nodeProbe struct {
+	Line    string
+	Latency time.Duration
+}
+
+// probeAndFilter dials host:port (extracted via hostKey) for every line,
+// with a TLS handshake for vless URIs with security=tls, and returns only
+// the lines that responded within cfg.Timeout (and, if set, within
+// cfg.MaxLatency). Order is preserved. Lines whose host:port can't be
+// determined pass through unprobed rather than being dropped; this includes
+// every vmess line, since hostKey does not decode the base64 payload, so
+// vmess nodes are neither dialed nor TLS-checked.
+func probeAndFilter(lines []string, cfg ProbeCfg, lru *probeLRU) []nodeProbe {
+	timeout := parseIntervalOrDefault(cfg.Timeout, defaultProbeTimeout)
+	maxLatency := parseIntervalOrDefault(cfg.MaxLatency, 0)
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultProbeConcurrency
+	}
+
+	results := make([]probeOutcome, len(lines))
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, line := range lines {
+		i, line := i, line
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = probeOne(line, timeout, cfg.TLSSNICheck, lru)
+		}()
+	}
+	wg.Wait()
+
+	out := make([]nodeProbe, 0, len(lines))
+	for i, line := range lines {
+		r := results[i]
+		if !r.ok {
+			continue
+		}
+		if maxLatency > 0 && r.latency > maxLatency {
+			continue
+		}
+		out = append(out, nodeProbe{Line: line, Latency: r.latency})
+	}
+	return out
+}
+
+// probeOutcome is the result of probing a single line, before the
+// timeout/max-latency filter in probeAndFilter is applied.
+type probeOutcome struct {
+	ok      bool
+	latency time.Duration
+}
+
+func probeOne(line string, timeout time.Duration, sniCheck bool, lru *probeLRU) probeOutcome {
+	hostport := hostKey(line)
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		// Can't dial something we can't address (e.g. an un-parseable vmess
+		// payload) - let it through unprobed rather than discard it.
+		return probeOutcome{ok: true}
+	}
+
+	if cached, ok := lru.get(hostport); ok {
+		return probeOutcome{ok: cached.ok, latency: cached.latency}
+	}
+
+	ok, latency := dialProbe(hostport, line, timeout, sniCheck)
+	lru.put(hostport, probeResult{ok: ok, latency: latency})
+	return probeOutcome{ok: ok, latency: latency}
+}
+
+func dialProbe(hostport, line string, timeout time.Duration, sniCheck bool) (bool, time.Duration) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", hostport, timeout)
+	if err != nil {
+		return false, 0
+	}
+	defer conn.Close()
+
+	if needsTLSProbe(line) {
+		host, _, _ := net.SplitHostPort(hostport)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: !sniCheck})
+		_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err := tlsConn.Handshake(); err != nil {
+			return false, 0
+		}
+	}
+	return true, time.Since(start)
+}
+
+// needsTLSProbe reports whether line's scheme advertises a TLS transport
+// worth handshaking against, per the URI's own query string. A vmess line
+// keeps its settings in a base64 payload with no such query string, so it
+// never matches.
+func needsTLSProbe(line string) bool {
+	l := strings.ToLower(line)
+	if !strings.HasPrefix(l, "vless://") && !strings.HasPrefix(l, "vmess://") {
+		return false
+	}
+	return strings.Contains(l, "security=tls")
+}
+
+// buildLite selects the lite set from aliveLines. With lite.strategy
+// "fastest" and probe results available, it sorts by measured RTT ascending;
+// otherwise it falls back to the historical "last N preserving order".
+func buildLite(cfg LiteCfg, aliveLines []string, latencyByLine map[string]time.Duration) []string {
+	n := cfg.N
+	if n <= 0 {
+		n = 100
+	}
+	if cfg.Strategy == "fastest" && latencyByLine != nil {
+		cp := append([]string(nil), aliveLines...)
+		sort.SliceStable(cp, func(i, j int) bool { return latencyByLine[cp[i]] < latencyByLine[cp[j]] })
+		if n > len(cp) {
+			n = len(cp)
+		}
+		return append([]string(nil), cp[:n]...)
+	}
+	return buildLiteTail(aliveLines, n)
+}
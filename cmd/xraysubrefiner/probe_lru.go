@@ -0,0 +1,77 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// probeResult is the cached outcome of dialing one host:port.
+type probeResult struct {
+	ok      bool
+	latency time.Duration
+	at      time.Time
+}
+
+// probeLRU is a small bounded, TTL-aware cache of recent probe results keyed
+// by host:port, so daemon-mode runs don't re-dial nodes they just checked.
+type probeLRU struct {
+	mu       sync.Mutex
+	cap      int
+	ttl      time.Duration
+	order    *list.List // most-recently-used at the back
+	elements map[string]*list.Element
+}
+
+type probeLRUEntry struct {
+	key    string
+	result probeResult
+}
+
+func newProbeLRU(capacity int, ttl time.Duration) *probeLRU {
+	return &probeLRU{
+		cap:      capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (l *probeLRU) get(key string) (probeResult, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.elements[key]
+	if !ok {
+		return probeResult{}, false
+	}
+	entry := el.Value.(*probeLRUEntry)
+	if time.Since(entry.result.at) > l.ttl {
+		l.order.Remove(el)
+		delete(l.elements, key)
+		return probeResult{}, false
+	}
+	l.order.MoveToBack(el)
+	return entry.result, true
+}
+
+func (l *probeLRU) put(key string, r probeResult) {
+	r.at = time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.elements[key]; ok {
+		el.Value.(*probeLRUEntry).result = r
+		l.order.MoveToBack(el)
+		return
+	}
+	el := l.order.PushBack(&probeLRUEntry{key: key, result: r})
+	l.elements[key] = el
+	for l.order.Len() > l.cap {
+		oldest := l.order.Front()
+		if oldest == nil {
+			break
+		}
+		l.order.Remove(oldest)
+		delete(l.elements, oldest.Value.(*probeLRUEntry).key)
+	}
+}
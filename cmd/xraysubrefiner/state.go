@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fetchState is the per-subscription conditional-request state persisted
+// across runs so unchanged sources can skip the parse/dedupe/write pipeline.
+type fetchState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	PayloadHash  string `json:"payload_hash,omitempty"`
+}
+
+// fetchStateStore persists fetchState per subscription key as a single JSON
+// file under the output directory, so a daemon restart (or the next cron
+// invocation) still knows what it last saw.
+type fetchStateStore struct {
+	path string
+
+	mu   sync.Mutex
+	data map[string]fetchState
+}
+
+func loadFetchStateStore(outDir string) *fetchStateStore {
+	s := &fetchStateStore{
+		path: filepath.Join(outDir, ".refiner-state.json"),
+		data: map[string]fetchState{},
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return s
+	}
+	_ = json.Unmarshal(b, &s.data) // best-effort; a corrupt file just means a full re-fetch
+	return s
+}
+
+func (s *fetchStateStore) get(key string) fetchState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key]
+}
+
+func (s *fetchStateStore) set(key string, st fetchState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = st
+	_ = s.saveLocked()
+}
+
+func (s *fetchStateStore) saveLocked() error {
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, b, 0o644)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// subCache holds the Base64-encoded payloads currently served for one
+// subscription. Swapped atomically under mu on every refresh.
+type subCache struct {
+	mu        sync.RWMutex
+	normalB64 []byte
+	liteB64   []byte
+}
+
+func (c *subCache) snapshot(variant string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	switch variant {
+	case "normal":
+		return c.normalB64, c.normalB64 != nil
+	case "lite":
+		return c.liteB64, c.liteB64 != nil
+	default:
+		return nil, false
+	}
+}
+
+func (c *subCache) set(normalB64, liteB64 []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.normalB64 = normalB64
+	c.liteB64 = liteB64
+}
+
+// store keeps the refined output of every configured subscription in memory
+// so it can be served over HTTP/gRPC without re-invoking the CLI, and knows
+// how to re-run the refine pipeline for a single subscription on demand.
+type store struct {
+	client   *http.Client
+	allowed  map[string]struct{}
+	outDir   string
+	liteCfg  LiteCfg
+	probeCfg ProbeCfg
+	outputs  []string
+	state    *fetchStateStore
+	lru      *probeLRU
+	sem      chan struct{} // bounds concurrent Refresh calls across subscriptions
+
+	mu    sync.RWMutex
+	subs  map[string]Subscription
+	order []string
+	cache map[string]*subCache
+}
+
+func newStore(cfg *Config, client *http.Client, allowed map[string]struct{}, outDir string, workers int) *store {
+	if workers <= 0 {
+		workers = 1
+	}
+	s := &store{
+		client:   client,
+		allowed:  allowed,
+		outDir:   outDir,
+		liteCfg:  cfg.Lite,
+		probeCfg: cfg.Probe,
+		outputs:  cfg.Outputs,
+		state:    loadFetchStateStore(outDir),
+		lru:      newProbeLRU(probeLRUCapacity, probeLRUTTL),
+		sem:      make(chan struct{}, workers),
+		subs:     map[string]Subscription{},
+		cache:    map[string]*subCache{},
+	}
+	for _, sub := range cfg.Subscriptions {
+		s.subs[sub.Key] = sub
+		s.order = append(s.order, sub.Key)
+		s.cache[sub.Key] = &subCache{}
+	}
+	return s
+}
+
+// refineAll runs the pipeline for every configured subscription, writing
+// files under outDir and populating the in-memory cache. Subscriptions are
+// refreshed concurrently, bounded by the store's worker pool, instead of the
+// strictly sequential loop this replaced. Errors are logged per-subscription
+// and don't stop the rest from refreshing.
+func (s *store) refineAll() {
+	var wg sync.WaitGroup
+	for _, key := range s.order {
+		key := key
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Refresh(key); err != nil {
+				fmt.Printf("!! refresh error %s: %v\n", key, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Refresh re-runs fetch -> decode -> parse -> dedupe for a single
+// subscription, honoring the persisted ETag/Last-Modified and payload hash
+// to skip unchanged sources entirely, then writes the resulting files and
+// swaps the cached Base64 payloads in one atomic step.
+func (s *store) Refresh(key string) error {
+	s.mu.RLock()
+	sub, ok := s.subs[key]
+	cache := s.cache[key]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown subscription %q", key)
+	}
+
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	fmt.Printf("Processing %s (%s)\n", sub.Key, sub.URL)
+	prev := s.state.get(key)
+	outcome, err := refineSubscription(s.client, sub, s.allowed, s.liteCfg, s.probeCfg, s.lru, prev)
+	if err != nil {
+		return err
+	}
+
+	s.state.set(key, fetchState{ETag: outcome.ETag, LastModified: outcome.LastModified, PayloadHash: outcome.PayloadHash})
+
+	outputsPresent := allFilesExist(expectedOutputFiles(s.outDir, sub, s.outputs))
+	if outcome.NotModified && outputsPresent {
+		fmt.Printf("Skipping write for %s (unchanged)\n", sub.Key)
+		// Still populate the cache if this is the first run after a daemon
+		// restart; a genuine 304 with no body leaves Normal/Lite nil and the
+		// cache untouched, which is fine since it was already populated.
+		if outcome.Normal != nil {
+			if _, ok := cache.snapshot("normal"); !ok {
+				cache.set(encodeBase64Sorted(outcome.Normal), encodeBase64(outcome.Lite))
+			}
+		}
+		return nil
+	}
+
+	if outcome.NotModified && outcome.Normal == nil {
+		// A genuine 304 carries no body, so there's nothing to rewrite from;
+		// this only happens right after outDir was cleared or the outputs
+		// config changed mid-flight. It self-heals on the next upstream
+		// change; until then, log it rather than writing empty files.
+		fmt.Printf("!! outputs missing for %s but upstream returned 304 with no body; will retry next refresh\n", sub.Key)
+		return nil
+	}
+	if outcome.NotModified {
+		fmt.Printf("Outputs missing for %s despite unchanged payload; rewriting\n", sub.Key)
+	}
+
+	if err := writeSubscriptionFiles(s.outDir, sub, outcome.Normal, outcome.Lite, s.outputs); err != nil {
+		return err
+	}
+	cache.set(encodeBase64Sorted(outcome.Normal), encodeBase64(outcome.Lite))
+	return nil
+}
+
+// Get returns the cached Base64 payload for key/variant ("normal" or
+// "lite"), or ok=false if the key is unknown or hasn't been refined yet.
+func (s *store) Get(key, variant string) ([]byte, bool) {
+	s.mu.RLock()
+	cache, ok := s.cache[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return cache.snapshot(variant)
+}
+
+// Keys returns the configured subscription keys in config order.
+func (s *store) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.order...)
+}
+
+// Sub returns the configured Subscription for key.
+func (s *store) Sub(key string) (Subscription, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.subs[key]
+	return sub, ok
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormat describes one non-base64 writer: the file suffix it writes
+// (appended to "normal"/"lite") and how to turn a line set into bytes.
+type outputFormat struct {
+	suffix string
+	encode func(lines []string) ([]byte, error)
+}
+
+var outputFormats = map[string]outputFormat{
+	"clash":   {suffix: ".clash.yaml", encode: encodeClash},
+	"singbox": {suffix: ".singbox.json", encode: encodeSingbox},
+	"plain":   {suffix: ".txt", encode: encodePlain},
+}
+
+func encodePlain(lines []string) ([]byte, error) {
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// ClashProxy is a single entry of a Clash config's top-level "proxies" list.
+type ClashProxy struct {
+	Name     string       `yaml:"name"`
+	Type     string       `yaml:"type"`
+	Server   string       `yaml:"server"`
+	Port     int          `yaml:"port"`
+	UUID     string       `yaml:"uuid,omitempty"`
+	Password string       `yaml:"password,omitempty"`
+	Cipher   string       `yaml:"cipher,omitempty"`
+	Network  string       `yaml:"network,omitempty"`
+	TLS      bool         `yaml:"tls,omitempty"`
+	SNI      string       `yaml:"servername,omitempty"`
+	WSOpts   *ClashWSOpts `yaml:"ws-opts,omitempty"`
+}
+
+type ClashWSOpts struct {
+	Path    string            `yaml:"path,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+func encodeClash(lines []string) ([]byte, error) {
+	nodes := parseNodes(lines)
+	proxies := make([]ClashProxy, 0, len(nodes))
+	for i, n := range nodes {
+		proxies = append(proxies, toClashProxy(n, i))
+	}
+	return yaml.Marshal(map[string]interface{}{"proxies": proxies})
+}
+
+func toClashProxy(n Node, index int) ClashProxy {
+	p := ClashProxy{
+		Name:    proxyName(n, index),
+		Type:    n.Scheme,
+		Server:  n.Server,
+		Port:    n.Port,
+		UUID:    n.UUID,
+		Network: n.Network,
+		TLS:     n.TLS,
+		SNI:     n.SNI,
+	}
+	if n.Scheme == "ss" {
+		p.Cipher = n.Method
+		p.Password = n.Password
+	}
+	if n.Network == "ws" && (n.Path != "" || n.Host != "") {
+		p.WSOpts = &ClashWSOpts{Path: n.Path}
+		if n.Host != "" {
+			p.WSOpts.Headers = map[string]string{"Host": n.Host}
+		}
+	}
+	return p
+}
+
+// SingboxOutbound is a single entry of a sing-box config's "outbounds" list.
+type SingboxOutbound struct {
+	Type       string            `json:"type"`
+	Tag        string            `json:"tag"`
+	Server     string            `json:"server"`
+	ServerPort int               `json:"server_port"`
+	UUID       string            `json:"uuid,omitempty"`
+	Password   string            `json:"password,omitempty"`
+	Method     string            `json:"method,omitempty"`
+	TLS        *SingboxTLS       `json:"tls,omitempty"`
+	Transport  *SingboxTransport `json:"transport,omitempty"`
+}
+
+type SingboxTLS struct {
+	Enabled    bool   `json:"enabled"`
+	ServerName string `json:"server_name,omitempty"`
+}
+
+type SingboxTransport struct {
+	Type string   `json:"type"`
+	Path string   `json:"path,omitempty"`
+	Host []string `json:"host,omitempty"`
+}
+
+func encodeSingbox(lines []string) ([]byte, error) {
+	nodes := parseNodes(lines)
+	outbounds := make([]SingboxOutbound, 0, len(nodes))
+	for i, n := range nodes {
+		outbounds = append(outbounds, toSingboxOutbound(n, i))
+	}
+	return json.MarshalIndent(map[string]interface{}{"outbounds": outbounds}, "", "  ")
+}
+
+func toSingboxOutbound(n Node, index int) SingboxOutbound {
+	o := SingboxOutbound{
+		Type:       singboxType(n.Scheme),
+		Tag:        proxyName(n, index),
+		Server:     n.Server,
+		ServerPort: n.Port,
+		UUID:       n.UUID,
+	}
+	if n.Scheme == "ss" {
+		o.Method = n.Method
+		o.Password = n.Password
+	}
+	if n.TLS {
+		o.TLS = &SingboxTLS{Enabled: true, ServerName: n.SNI}
+	}
+	if n.Network == "ws" {
+		o.Transport = &SingboxTransport{Type: "ws", Path: n.Path}
+		if n.Host != "" {
+			o.Transport.Host = []string{n.Host}
+		}
+	}
+	return o
+}
+
+// singboxType maps a Node.Scheme to sing-box's outbound "type" string; only
+// Shadowsocks needs translating, since vless/vmess already match.
+func singboxType(scheme string) string {
+	if scheme == "ss" {
+		return "shadowsocks"
+	}
+	return scheme
+}
+
+// proxyName picks a stable, non-empty display name for a node.
+func proxyName(n Node, index int) string {
+	if n.Remark != "" {
+		return n.Remark
+	}
+	return n.Scheme + "-" + n.Server + "-" + strconv.Itoa(index)
+}